@@ -0,0 +1,52 @@
+package auth_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/travisjeffery/proglog/internal/auth"
+)
+
+func TestAuthorize(t *testing.T) {
+	authorizer, err := auth.New(
+		filepath.Join("testdata", "model.conf"),
+		filepath.Join("testdata", "policy.csv"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]struct {
+		subject string
+		action  string
+		wantErr bool
+	}{
+		"superuser can produce":    {subject: "root", action: "produce"},
+		"superuser can consume":    {subject: "root", action: "consume"},
+		"read-only can consume":    {subject: "nobody", action: "consume"},
+		"read-only cannot produce": {subject: "nobody", action: "produce", wantErr: true},
+		"unknown subject denied":   {subject: "intruder", action: "consume", wantErr: true},
+	}
+
+	for name, tt := range tests {
+		tt := tt
+		t.Run(name, func(t *testing.T) {
+			err := authorizer.Authorize(tt.subject, "log", tt.action)
+			if tt.wantErr && err == nil {
+				t.Fatalf("got nil err, want PermissionDenied")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("got err: %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestNewBadPolicyFile(t *testing.T) {
+	if _, err := auth.New(
+		filepath.Join("testdata", "model.conf"),
+		filepath.Join("testdata", "does-not-exist.csv"),
+	); err == nil {
+		t.Fatal("got nil err, want an error from a missing policy file")
+	}
+}
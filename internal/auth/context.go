@@ -0,0 +1,19 @@
+package auth
+
+import "context"
+
+type subjectKey struct{}
+
+// WithSubject returns a context carrying the authenticated subject (the
+// client cert's CommonName), so downstream code such as replication or
+// audit logging can see who initiated the request without re-parsing the
+// peer cert itself.
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey{}, subject)
+}
+
+// Subject returns the subject stored by WithSubject, or "" if none was set.
+func Subject(ctx context.Context) string {
+	subject, _ := ctx.Value(subjectKey{}).(string)
+	return subject
+}
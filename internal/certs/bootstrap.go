@@ -0,0 +1,53 @@
+package certs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Bootstrap generates an internal CA plus this node's cert on first boot,
+// writing them under dir. It's a no-op if the CA already exists there, so
+// it's safe to call on every startup.
+//
+// The node cert carries both the ServerAuth and ClientAuth EKUs: a node
+// dials its peers (raft, replication) with the same identity it serves
+// incoming connections with, so setupAutoTLS only ever needs the one
+// rotator over server.pem/server-key.pem for both directions.
+func Bootstrap(dir string, hosts []string) error {
+	caCertFile := filepath.Join(dir, "ca.pem")
+	caKeyFile := filepath.Join(dir, "ca-key.pem")
+
+	if _, err := os.Stat(caCertFile); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("create cert dir: %w", err)
+	}
+
+	ca, err := NewCA()
+	if err != nil {
+		return fmt.Errorf("generate ca: %w", err)
+	}
+	if err := writeFile(caCertFile, ca.CertPEM); err != nil {
+		return err
+	}
+	if err := writeFile(caKeyFile, ca.KeyPEM); err != nil {
+		return err
+	}
+
+	certPEM, keyPEM, err := ca.IssueCert(hosts, true, true)
+	if err != nil {
+		return fmt.Errorf("issue node cert: %w", err)
+	}
+	if err := writeFile(filepath.Join(dir, "server.pem"), certPEM); err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "server-key.pem"), keyPEM)
+}
+
+func writeFile(path string, data []byte) error {
+	return ioutil.WriteFile(path, data, 0600)
+}
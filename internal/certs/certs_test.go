@@ -0,0 +1,82 @@
+package certs_test
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/travisjeffery/proglog/internal/certs"
+)
+
+// TestBootstrapMutualTLS exercises a loopback mutual-TLS handshake using
+// exactly the cert Bootstrap writes and the rotator setupAutoTLS builds over
+// it, in both directions: this node dialing out with the cert it also
+// serves incoming connections with. It's the regression test for the EKU
+// bug where server.pem only carried ExtKeyUsageServerAuth, so a node could
+// never dial a peer under AutoTLS.
+func TestBootstrapMutualTLS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "certs-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if err := certs.Bootstrap(dir, []string{"127.0.0.1"}); err != nil {
+		t.Fatal(err)
+	}
+
+	rotator, err := certs.NewRotator(
+		filepath.Join(dir, "server.pem"),
+		filepath.Join(dir, "server-key.pem"),
+		filepath.Join(dir, "ca.pem"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caPool, err := rotator.CAPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverTLSConfig := &tls.Config{
+		GetCertificate: rotator.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      caPool,
+	}
+	clientTLSConfig := &tls.Config{
+		GetClientCertificate: rotator.GetClientCertificate,
+		RootCAs:              caPool,
+		ServerName:           "127.0.0.1",
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	accepted := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			accepted <- err
+			return
+		}
+		defer conn.Close()
+		accepted <- tls.Server(conn, serverTLSConfig).Handshake()
+	}()
+
+	conn, err := tls.Dial("tcp", ln.Addr().String(), clientTLSConfig)
+	if err != nil {
+		t.Fatalf("client dial (same cert used for outbound raft/replication dials): %s", err)
+	}
+	defer conn.Close()
+
+	if err := <-accepted; err != nil {
+		t.Fatalf("server handshake: %s", err)
+	}
+}
@@ -0,0 +1,103 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// Rotator reloads a cert/key pair and CA bundle off disk so a gRPC server
+// can rotate its identity, or an operator's new root, without a restart.
+// The leaf cert/key are cached and swapped atomically on RotateInterval;
+// the CA pool is re-read on every handshake, which is what lets an operator
+// append a new CA, roll the fleet, then remove the old one with no
+// downtime.
+type Rotator struct {
+	certFile, keyFile string
+	caFile            string
+
+	current atomic.Value // holds *tls.Certificate
+
+	stop chan struct{}
+}
+
+// NewRotator loads the initial cert/key pair from disk and returns a
+// Rotator ready to serve it via GetCertificate/GetClientCertificate.
+func NewRotator(certFile, keyFile, caFile string) (*Rotator, error) {
+	r := &Rotator{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		stop:     make(chan struct{}),
+	}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Start begins reloading the leaf cert/key from disk every interval. It
+// returns immediately; call Close to stop the background goroutine.
+func (r *Rotator) Start(interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := r.reload(); err != nil {
+					// Keep serving the last good cert; a bad reload (e.g. a
+					// half-written file) shouldn't take the server down.
+					continue
+				}
+			case <-r.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (r *Rotator) Close() {
+	close(r.stop)
+}
+
+func (r *Rotator) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("load cert/key: %w", err)
+	}
+	r.current.Store(&cert)
+	return nil
+}
+
+// GetCertificate satisfies tls.Config.GetCertificate.
+func (r *Rotator) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current.Load().(*tls.Certificate), nil
+}
+
+// GetClientCertificate satisfies tls.Config.GetClientCertificate, so
+// outbound replication dials pick up a rotated client identity too.
+func (r *Rotator) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current.Load().(*tls.Certificate), nil
+}
+
+// CAPool re-reads the CA bundle from disk on every call rather than caching
+// it, so callers should use it from a tls.Config.GetConfigForClient (or
+// equivalent per-handshake hook) instead of reading it once at startup.
+func (r *Rotator) CAPool() (*x509.CertPool, error) {
+	raw, err := ioutil.ReadFile(r.caFile)
+	if err != nil {
+		return nil, fmt.Errorf("read ca bundle: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(raw) {
+		return nil, fmt.Errorf("no certs found in %s", r.caFile)
+	}
+	return pool, nil
+}
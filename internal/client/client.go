@@ -0,0 +1,32 @@
+// Package client builds the Log gRPC client the rest of the system (and
+// its tests) should dial with, so every caller gets the error-unwrapping
+// interceptor pair from interceptors/errors for free instead of having to
+// remember to wire it up themselves.
+package client
+
+import (
+	"crypto/tls"
+
+	api "github.com/travisjeffery/proglog/api/v1"
+	ierrors "github.com/travisjeffery/proglog/internal/interceptors/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// New dials addr and returns a Log client plus the underlying connection,
+// which the caller owns and must Close.
+func New(addr string, tlsConfig *tls.Config, opts ...grpc.DialOption) (api.LogClient, *grpc.ClientConn, error) {
+	opts = append(opts,
+		grpc.WithUnaryInterceptor(ierrors.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(ierrors.StreamClientInterceptor()),
+	)
+	if tlsConfig != nil {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(tlsConfig)))
+	}
+
+	cc, err := grpc.Dial(addr, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return api.NewLogClient(cc), cc, nil
+}
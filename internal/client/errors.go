@@ -0,0 +1,46 @@
+package client
+
+import (
+	"regexp"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	api "github.com/travisjeffery/proglog/api/v1"
+	ierrors "github.com/travisjeffery/proglog/internal/interceptors/errors"
+)
+
+// offsetSuffix pulls the offset back out of the LocalizedMessage detail
+// api.ErrOffsetOutOfRange.GRPCStatus attaches, e.g. "...log's range: 42".
+var offsetSuffix = regexp.MustCompile(`(\d+)$`)
+
+// init registers api.ErrOffsetOutOfRange with the errors package so a
+// client dialed through New transparently turns a NotFound status that
+// comes back over the wire into that same type, offset and all, letting
+// callers use errors.Is(err, api.ErrOffsetOutOfRange{}) instead of comparing
+// codes.
+func init() {
+	ierrors.Register(func(st *status.Status) (error, bool) {
+		if st.Code() != codes.NotFound {
+			return nil, false
+		}
+		for _, d := range st.Details() {
+			msg, ok := d.(*errdetails.LocalizedMessage)
+			if !ok {
+				continue
+			}
+			m := offsetSuffix.FindStringSubmatch(msg.Message)
+			if m == nil {
+				continue
+			}
+			offset, err := strconv.ParseUint(m[1], 10, 64)
+			if err != nil {
+				continue
+			}
+			return api.ErrOffsetOutOfRange{Offset: offset}, true
+		}
+		return api.ErrOffsetOutOfRange{}, true
+	})
+}
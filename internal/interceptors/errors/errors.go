@@ -0,0 +1,125 @@
+// Package errors provides a matched pair of gRPC interceptors that keep
+// typed domain errors intact across the wire: the server-side interceptor
+// makes sure a handler's error crosses as its own gRPC status (with
+// details) rather than being flattened to codes.Unknown, and the
+// client-side interceptor reconstructs the original Go error type from
+// that status so callers can use errors.Is/errors.As instead of comparing
+// gRPC codes by hand.
+package errors
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// GRPCStatusError is satisfied by any domain error (e.g.
+// api.ErrOffsetOutOfRange) that knows how to represent itself as a rich
+// *status.Status, typically carrying a proto detail message.
+type GRPCStatusError interface {
+	error
+	GRPCStatus() *status.Status
+}
+
+// FromStatusFunc attempts to reconstruct a domain error from a status
+// received over the wire, returning ok=false if it doesn't recognize it.
+type FromStatusFunc func(*status.Status) (err error, ok bool)
+
+var unwrapFuncs []FromStatusFunc
+
+// Register adds fn to the chain FromStatus consults. Domain packages that
+// define their own GRPCStatusError types (like api.ErrOffsetOutOfRange)
+// call this from an init() so client.New-dialed connections transparently
+// turn the status that comes back over the wire into that same type.
+func Register(fn FromStatusFunc) {
+	unwrapFuncs = append(unwrapFuncs, fn)
+}
+
+// FromStatus runs every registered FromStatusFunc against st, returning the
+// first reconstructed error, or st.Err() unchanged if none recognize it.
+func FromStatus(st *status.Status) error {
+	for _, fn := range unwrapFuncs {
+		if err, ok := fn(st); ok {
+			return err
+		}
+	}
+	return st.Err()
+}
+
+// UnaryServerInterceptor makes sure an error a handler returns crosses the
+// wire as its own gRPC status (and details) when it has one, instead of
+// falling through to the default codes.Unknown.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		res, err := handler(ctx, req)
+		return res, toWireError(err)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor's streaming twin.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		return toWireError(handler(srv, ss))
+	}
+}
+
+func toWireError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if gse, ok := err.(GRPCStatusError); ok {
+		return gse.GRPCStatus().Err()
+	}
+	return err
+}
+
+// UnaryClientInterceptor turns a status that comes back over the wire into
+// the original domain error type via FromStatus.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption,
+	) error {
+		return fromWireError(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
+
+// StreamClientInterceptor is UnaryClientInterceptor's streaming twin.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(
+		ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn,
+		method string, streamer grpc.Streamer, opts ...grpc.CallOption,
+	) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			return nil, fromWireError(err)
+		}
+		return &clientStream{ClientStream: cs}, nil
+	}
+}
+
+// clientStream runs the errors a server streams back through fromWireError,
+// since those arrive from RecvMsg rather than from opening the stream.
+type clientStream struct {
+	grpc.ClientStream
+}
+
+func (s *clientStream) RecvMsg(m interface{}) error {
+	return fromWireError(s.ClientStream.RecvMsg(m))
+}
+
+func fromWireError(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	return FromStatus(st)
+}
@@ -0,0 +1,54 @@
+package errors_test
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	ierrors "github.com/travisjeffery/proglog/internal/interceptors/errors"
+)
+
+// fakeNotFound carries its ID in an errdetails.ResourceInfo detail, the way
+// a real domain error (like api.ErrOffsetOutOfRange) attaches a registered
+// proto detail message via status.WithDetails.
+type fakeNotFound struct{ ID string }
+
+func (e fakeNotFound) Error() string { return "not found: " + e.ID }
+
+func (e fakeNotFound) GRPCStatus() *status.Status {
+	st, err := status.New(codes.NotFound, e.Error()).WithDetails(&errdetails.ResourceInfo{ResourceName: e.ID})
+	if err != nil {
+		return status.New(codes.NotFound, e.Error())
+	}
+	return st
+}
+
+func TestFromStatusRoundTrip(t *testing.T) {
+	ierrors.Register(func(st *status.Status) (error, bool) {
+		for _, d := range st.Details() {
+			if info, ok := d.(*errdetails.ResourceInfo); ok {
+				return fakeNotFound{ID: info.ResourceName}, true
+			}
+		}
+		return nil, false
+	})
+
+	original := fakeNotFound{ID: "42"}
+	wireErr := original.GRPCStatus().Err()
+
+	got := ierrors.FromStatus(status.Convert(wireErr))
+	if !stderrors.Is(got, original) {
+		t.Fatalf("got: %v, want: %v", got, original)
+	}
+}
+
+func TestFromStatusUnrecognized(t *testing.T) {
+	st := status.New(codes.Internal, "boom")
+	got := ierrors.FromStatus(st)
+	if !stderrors.Is(got, st.Err()) {
+		t.Fatalf("got: %v, want: %v", got, st.Err())
+	}
+}
@@ -0,0 +1,153 @@
+package raftlog
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/raft"
+	api "github.com/travisjeffery/proglog/api/v1"
+)
+
+// RequestType identifies the kind of command encoded in a raft.Log before the
+// FSM is asked to apply it. Today there's only one kind of write the log
+// knows how to replicate, but keeping the byte prefix leaves room to add more
+// (e.g. configuration commands) without breaking existing log entries.
+type RequestType uint8
+
+const (
+	AppendRequestType RequestType = 0
+)
+
+// CommitLog is the subset of the log used by the book that the FSM drives.
+// It mirrors the logger interface the gRPC server already depends on so the
+// same log implementation can serve both.
+type CommitLog interface {
+	AppendBatch(*api.RecordBatch) (uint64, error)
+	ReadBatch(uint64) (*api.RecordBatch, error)
+}
+
+type fsm struct {
+	log CommitLog
+}
+
+var _ raft.FSM = (*fsm)(nil)
+
+// Apply is invoked by raft once a log entry has been committed by a quorum
+// of the cluster. Apart from Restore, it's the only place AppendBatch is
+// called from when the log is raft-backed, so every follower ends up with
+// identical offsets.
+func (f *fsm) Apply(record *raft.Log) interface{} {
+	buf := record.Data
+	reqType := RequestType(buf[0])
+	switch reqType {
+	case AppendRequestType:
+		return f.applyAppend(buf[1:])
+	}
+	return nil
+}
+
+func (f *fsm) applyAppend(b []byte) interface{} {
+	var req api.ProduceRequest
+	if err := req.Unmarshal(b); err != nil {
+		return err
+	}
+	offset, err := f.log.AppendBatch(req.RecordBatch)
+	if err != nil {
+		return err
+	}
+	return &api.ProduceResponse{FirstOffset: offset}
+}
+
+// Snapshot returns a snapshot of the log's state so raft can compact its own
+// log and catch up slow followers without replaying every entry. Offsets in
+// the commit log are stable, so the snapshot is just the read side of it.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	return &snapshot{log: f.log}, nil
+}
+
+// Restore installs a snapshot taken by Snapshot, replacing the FSM's state
+// wholesale. It's called on startup when there's a snapshot on disk and when
+// a follower is too far behind to catch up via the raft log alone.
+func (f *fsm) Restore(r io.ReadCloser) error {
+	for {
+		var batch api.RecordBatch
+		if err := readBatch(r, &batch); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		if _, err := f.log.AppendBatch(&batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type snapshot struct {
+	log CommitLog
+}
+
+var _ raft.FSMSnapshot = (*snapshot)(nil)
+
+func (s *snapshot) Persist(sink raft.SnapshotSink) error {
+	var offset uint64
+	for {
+		batch, err := s.log.ReadBatch(offset)
+		if err != nil {
+			break
+		}
+		if err := writeBatch(sink, batch); err != nil {
+			sink.Cancel()
+			return err
+		}
+		offset++
+	}
+	return sink.Close()
+}
+
+func (s *snapshot) Release() {}
+
+func writeBatch(w io.Writer, batch *api.RecordBatch) error {
+	b, err := batch.Marshal()
+	if err != nil {
+		return err
+	}
+	size := uint32(len(b))
+	if err := binaryWrite(w, size); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func readBatch(r io.Reader, batch *api.RecordBatch) error {
+	var size uint32
+	if err := binaryRead(r, &size); err != nil {
+		return err
+	}
+	b := make([]byte, size)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("read batch: %w", err)
+	}
+	return batch.Unmarshal(b)
+}
+
+func binaryWrite(w io.Writer, v uint32) error {
+	buf := make([]byte, 4)
+	buf[0] = byte(v >> 24)
+	buf[1] = byte(v >> 16)
+	buf[2] = byte(v >> 8)
+	buf[3] = byte(v)
+	_, err := w.Write(buf)
+	return err
+}
+
+func binaryRead(r io.Reader, v *uint32) error {
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	*v = uint32(buf[0])<<24 | uint32(buf[1])<<16 | uint32(buf[2])<<8 | uint32(buf[3])
+	return nil
+}
@@ -0,0 +1,69 @@
+package raftlog
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/raft"
+	api "github.com/travisjeffery/proglog/api/v1"
+)
+
+type fakeCommitLog struct {
+	batches []*api.RecordBatch
+}
+
+func (f *fakeCommitLog) AppendBatch(b *api.RecordBatch) (uint64, error) {
+	f.batches = append(f.batches, b)
+	return uint64(len(f.batches) - 1), nil
+}
+
+func (f *fakeCommitLog) ReadBatch(offset uint64) (*api.RecordBatch, error) {
+	if offset >= uint64(len(f.batches)) {
+		return nil, fmt.Errorf("offset out of range: %d", offset)
+	}
+	return f.batches[offset], nil
+}
+
+func TestFSMApplyAppend(t *testing.T) {
+	log := &fakeCommitLog{}
+	f := &fsm{log: log}
+
+	req := &api.ProduceRequest{RecordBatch: &api.RecordBatch{
+		Records: []*api.Record{{Value: []byte("hello world")}},
+	}}
+	b, err := req.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := append([]byte{byte(AppendRequestType)}, b...)
+
+	res := f.Apply(&raft.Log{Data: buf})
+	produceRes, ok := res.(*api.ProduceResponse)
+	if !ok {
+		t.Fatalf("got %T, want *api.ProduceResponse", res)
+	}
+	if produceRes.FirstOffset != 0 {
+		t.Fatalf("got offset: %d, want: 0", produceRes.FirstOffset)
+	}
+	if len(log.batches) != 1 {
+		t.Fatalf("got %d batches appended, want 1", len(log.batches))
+	}
+}
+
+func TestWriteReadBatchRoundTrip(t *testing.T) {
+	want := &api.RecordBatch{Records: []*api.Record{{Value: []byte("hello world")}}}
+
+	var buf bytes.Buffer
+	if err := writeBatch(&buf, want); err != nil {
+		t.Fatal(err)
+	}
+
+	var got api.RecordBatch
+	if err := readBatch(&buf, &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Records) != 1 || string(got.Records[0].Value) != "hello world" {
+		t.Fatalf("got: %+v, want: %+v", got, want)
+	}
+}
@@ -0,0 +1,216 @@
+// Package raftlog wraps a CommitLog in a hashicorp/raft FSM so writes are
+// replicated through a real consensus protocol instead of the fan-out dial
+// the gRPC server used to do on every Produce.
+package raftlog
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+	api "github.com/travisjeffery/proglog/api/v1"
+)
+
+// Config configures the raft node backing a Log. The StreamLayer carries
+// raft traffic on its own listener, separate from the gRPC server's (see
+// StreamLayer).
+type Config struct {
+	raft.Config
+	StreamLayer *StreamLayer
+	Bootstrap   bool
+	DataDir     string
+}
+
+// Log is the raft-backed replicated log. It exposes the same shape of API
+// the old fan-out replication needed (Append, IsLeader, leader address) so
+// grpcServer.Produce only has to change how it gets those answers, not what
+// it does with them.
+type Log struct {
+	config Config
+	log    CommitLog
+	raft   *raft.Raft
+}
+
+func NewLog(log CommitLog, config Config) (*Log, error) {
+	l := &Log{
+		config: config,
+		log:    log,
+	}
+	if err := l.setupRaft(config.DataDir); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *Log) setupRaft(dataDir string) error {
+	fsm := &fsm{log: l.log}
+
+	logDir := filepath.Join(dataDir, "raft", "log")
+	if err := os.MkdirAll(logDir, 0755); err != nil {
+		return err
+	}
+	logStore, err := raftboltdb.NewBoltStore(filepath.Join(logDir, "raft.db"))
+	if err != nil {
+		return fmt.Errorf("raft log store: %w", err)
+	}
+
+	stableStore := logStore
+
+	retain := 1
+	snapshotStore, err := raft.NewFileSnapshotStore(
+		filepath.Join(dataDir, "raft"), retain, os.Stderr,
+	)
+	if err != nil {
+		return fmt.Errorf("raft snapshot store: %w", err)
+	}
+
+	maxPool := 5
+	timeout := 10 * time.Second
+	transport := raft.NewNetworkTransport(
+		l.config.StreamLayer, maxPool, timeout, os.Stderr,
+	)
+
+	config := l.config.Config
+	if config.LocalID == "" {
+		config.LocalID = raft.ServerID(l.config.StreamLayer.RaftAddr())
+	}
+
+	l.raft, err = raft.NewRaft(&config, fsm, logStore, stableStore, snapshotStore, transport)
+	if err != nil {
+		return fmt.Errorf("new raft: %w", err)
+	}
+
+	hasState, err := raft.HasExistingState(logStore, stableStore, snapshotStore)
+	if err != nil {
+		return err
+	}
+	if l.config.Bootstrap && !hasState {
+		future := l.raft.BootstrapCluster(raft.Configuration{
+			Servers: []raft.Server{{
+				ID:      config.LocalID,
+				Address: transport.LocalAddr(),
+			}},
+		})
+		return future.Error()
+	}
+	return nil
+}
+
+// Append submits a record batch through raft so it's only durable, and only
+// returns an offset, once a quorum of the cluster has committed it.
+func (l *Log) Append(batch *api.RecordBatch) (uint64, error) {
+	res, err := l.apply(AppendRequestType, &api.ProduceRequest{RecordBatch: batch})
+	if err != nil {
+		return 0, err
+	}
+	return res.(*api.ProduceResponse).FirstOffset, nil
+}
+
+func (l *Log) apply(reqType RequestType, req interface {
+	Marshal() ([]byte, error)
+}) (interface{}, error) {
+	var buf []byte
+	buf = append(buf, byte(reqType))
+	b, err := req.Marshal()
+	if err != nil {
+		return nil, err
+	}
+	buf = append(buf, b...)
+
+	timeout := 10 * time.Second
+	future := l.raft.Apply(buf, timeout)
+	if future.Error() != nil {
+		return nil, future.Error()
+	}
+	res := future.Response()
+	if err, ok := res.(error); ok {
+		return nil, err
+	}
+	return res, nil
+}
+
+// IsLeader reports whether this node currently holds leadership.
+func (l *Log) IsLeader() bool {
+	return l.raft.State() == raft.Leader
+}
+
+// AppliedIndex returns this node's last applied Raft log index, which
+// callers export as a metric so replication lag can be graphed as the gap
+// between a follower's and the leader's exported value.
+func (l *Log) AppliedIndex() uint64 {
+	return l.raft.AppliedIndex()
+}
+
+// Leader returns the raft address of the current leader, which Produce can
+// surface to followers so they know where to forward writes.
+func (l *Log) Leader() string {
+	addr, _ := l.raft.LeaderWithID()
+	return string(addr)
+}
+
+// LeaderID returns the raft server ID (the Serf member name, since LocalID
+// is set to match) of the current leader, which notLeaderErr uses to look
+// the leader's RPC addr up in grpcServer.peers.
+func (l *Log) LeaderID() string {
+	_, id := l.raft.LeaderWithID()
+	return string(id)
+}
+
+// WaitForLeader blocks until the cluster has elected a leader or timeout
+// elapses, which tests and callers use to avoid racing cluster bootstrap.
+func (l *Log) WaitForLeader(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		if l.Leader() != "" {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for leader")
+		}
+		<-ticker.C
+	}
+}
+
+// AddVoter and RemoveServer are driven by Serf membership events so cluster
+// membership changes flow through the same gossip layer the rest of the
+// system already uses for discovery.
+func (l *Log) AddVoter(id, addr string) error {
+	if l.raft.State() != raft.Leader {
+		return nil
+	}
+	configFuture := l.raft.GetConfiguration()
+	if err := configFuture.Error(); err != nil {
+		return err
+	}
+	for _, srv := range configFuture.Configuration().Servers {
+		if srv.ID == raft.ServerID(id) && srv.Address == raft.ServerAddress(addr) {
+			return nil
+		}
+		if srv.ID == raft.ServerID(id) || srv.Address == raft.ServerAddress(addr) {
+			removeFuture := l.raft.RemoveServer(srv.ID, 0, 0)
+			if err := removeFuture.Error(); err != nil {
+				return err
+			}
+		}
+	}
+	addFuture := l.raft.AddVoter(raft.ServerID(id), raft.ServerAddress(addr), 0, 0)
+	return addFuture.Error()
+}
+
+func (l *Log) RemoveServer(id string) error {
+	if l.raft.State() != raft.Leader {
+		return nil
+	}
+	removeFuture := l.raft.RemoveServer(raft.ServerID(id), 0, 0)
+	return removeFuture.Error()
+}
+
+func (l *Log) Close() error {
+	f := l.raft.Shutdown()
+	return f.Error()
+}
@@ -0,0 +1,73 @@
+package raftlog
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// StreamLayer implements raft.StreamLayer on top of a net.Listener dedicated
+// to raft traffic (setupRaft binds it on Config.RaftBindAddr, separate from
+// the gRPC listener), so every conn Accept sees is raft traffic already and
+// Dial doesn't need to tag outgoing conns for a mux to route.
+//
+// TLS is optional: when serverTLSConfig is set, accepted conns are upgraded
+// to TLS; when peerTLSConfig is set, Dial builds a fresh *tls.Config for
+// every connection by calling it, so a rotated CA or leaf cert takes effect
+// on the very next dial without restarting anything.
+type StreamLayer struct {
+	ln              net.Listener
+	serverTLSConfig *tls.Config
+	peerTLSConfig   func() (*tls.Config, error)
+}
+
+func NewStreamLayer(ln net.Listener, serverTLSConfig *tls.Config, peerTLSConfig func() (*tls.Config, error)) *StreamLayer {
+	return &StreamLayer{
+		ln:              ln,
+		serverTLSConfig: serverTLSConfig,
+		peerTLSConfig:   peerTLSConfig,
+	}
+}
+
+func (s *StreamLayer) Dial(addr raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.Dial("tcp", string(addr))
+	if err != nil {
+		return nil, err
+	}
+
+	if s.peerTLSConfig == nil {
+		return conn, nil
+	}
+	tlsConfig, err := s.peerTLSConfig()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return tls.Client(conn, tlsConfig), nil
+}
+
+func (s *StreamLayer) Accept() (net.Conn, error) {
+	conn, err := s.ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	if s.serverTLSConfig == nil {
+		return conn, nil
+	}
+	return tls.Server(conn, s.serverTLSConfig), nil
+}
+
+func (s *StreamLayer) Close() error {
+	return s.ln.Close()
+}
+
+func (s *StreamLayer) Addr() net.Addr {
+	return s.ln.Addr()
+}
+
+func (s *StreamLayer) RaftAddr() string {
+	return s.ln.Addr().String()
+}
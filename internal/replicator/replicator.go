@@ -0,0 +1,183 @@
+// Package replicator is the lightweight, gossip-driven replication path
+// used when a node isn't running a Raft cluster (see raftlog): instead of
+// raft.NetworkTransport's pooled connections and AppendEntries RPCs, it
+// maintains its own long-lived *grpc.ClientConn per Serf peer and fans
+// Produce calls out to them directly.
+//
+// Replication used to dial every peer from scratch on every single
+// Produce. That's the TODO this package replaces: connections are now
+// created once, when a peer joins, and a per-peer circuit breaker skips a
+// failing peer fast instead of blocking every Produce on it until its
+// context times out.
+package replicator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sony/gobreaker"
+	api "github.com/travisjeffery/proglog/api/v1"
+	"google.golang.org/grpc"
+)
+
+// Mode controls how many peers Replicate waits to hear back from before
+// Produce returns success.
+type Mode string
+
+const (
+	// ModeSyncAll waits for every peer to ack (the old replicateProduce's
+	// behavior).
+	ModeSyncAll Mode = "sync-all"
+	// ModeSyncQuorum waits for a majority of peers (including this node)
+	// to ack.
+	ModeSyncQuorum Mode = "sync-quorum"
+	// ModeAsync returns as soon as the append lands locally and replicates
+	// to peers in the background.
+	ModeAsync Mode = "async"
+)
+
+type peer struct {
+	cc      *grpc.ClientConn
+	client  api.LogClient
+	breaker *gobreaker.CircuitBreaker
+}
+
+// Replicator fans Produce requests out to every known peer, using a
+// long-lived connection and circuit breaker per peer rather than dialing
+// fresh on every call.
+type Replicator struct {
+	mode     Mode
+	dialOpts []grpc.DialOption
+
+	mu    sync.Mutex
+	peers map[string]*peer
+}
+
+func New(mode Mode, dialOpts ...grpc.DialOption) *Replicator {
+	return &Replicator{
+		mode:     mode,
+		dialOpts: dialOpts,
+		peers:    make(map[string]*peer),
+	}
+}
+
+// Join dials addr and keeps the connection around for future Replicate
+// calls, guarded by its own circuit breaker. Call it from a Serf
+// EventMemberJoin handler.
+func (r *Replicator) Join(id, addr string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.peers[id]; ok {
+		return nil
+	}
+
+	cc, err := grpc.Dial(addr, r.dialOpts...)
+	if err != nil {
+		return fmt.Errorf("dial peer %s (%s): %w", id, addr, err)
+	}
+
+	r.peers[id] = &peer{
+		cc:     cc,
+		client: api.NewLogClient(cc),
+		breaker: gobreaker.NewCircuitBreaker(gobreaker.Settings{
+			Name:    id,
+			Timeout: 10 * time.Second,
+		}),
+	}
+	return nil
+}
+
+// Leave tears down the connection kept for id. Call it from a Serf
+// EventMemberLeave/EventMemberFailed handler.
+func (r *Replicator) Leave(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.peers[id]
+	if !ok {
+		return nil
+	}
+	delete(r.peers, id)
+	return p.cc.Close()
+}
+
+// Replicate fans req out to every known peer according to r.mode. For
+// ModeAsync it returns immediately; for the sync modes it blocks until
+// enough peers (all of them, or a quorum) have acked, or ctx is done.
+func (r *Replicator) Replicate(ctx context.Context, req *api.ProduceRequest) error {
+	r.mu.Lock()
+	peers := make([]*peer, 0, len(r.peers))
+	for _, p := range r.peers {
+		peers = append(peers, p)
+	}
+	r.mu.Unlock()
+
+	if len(peers) == 0 {
+		return nil
+	}
+
+	if r.mode == ModeAsync {
+		for _, p := range peers {
+			p := p
+			go p.produce(context.Background(), req)
+		}
+		return nil
+	}
+
+	need := len(peers)
+	if r.mode == ModeSyncQuorum {
+		// This node already counts as one of the cluster's acks, so only
+		// the rest of a majority of (len(peers)+1) need to come from peers.
+		need = (len(peers) + 1) / 2
+	}
+
+	results := make(chan error, len(peers))
+	for _, p := range peers {
+		p := p
+		go func() { results <- p.produce(ctx, req) }()
+	}
+
+	var acked, failed int
+	for i := 0; i < len(peers); i++ {
+		if err := <-results; err != nil {
+			failed++
+		} else {
+			acked++
+		}
+		if acked >= need {
+			return nil
+		}
+		if r.mode == ModeSyncAll && failed > 0 {
+			return fmt.Errorf("replicate: %d/%d peers failed", failed, len(peers))
+		}
+	}
+	if acked < need {
+		return fmt.Errorf("replicate: only %d/%d peers acked, needed %d", acked, len(peers), need)
+	}
+	return nil
+}
+
+func (p *peer) produce(ctx context.Context, req *api.ProduceRequest) error {
+	_, err := p.breaker.Execute(func() (interface{}, error) {
+		return p.client.Produce(ctx, req)
+	})
+	return err
+}
+
+// Close tears down every peer connection.
+func (r *Replicator) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var firstErr error
+	for id, p := range r.peers {
+		if err := p.cc.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(r.peers, id)
+	}
+	return firstErr
+}
@@ -0,0 +1,55 @@
+package replicator
+
+import (
+	"context"
+	"testing"
+
+	api "github.com/travisjeffery/proglog/api/v1"
+	"google.golang.org/grpc"
+)
+
+func TestReplicateNoPeers(t *testing.T) {
+	r := New(ModeSyncAll)
+	err := r.Replicate(context.Background(), &api.ProduceRequest{
+		RecordBatch: &api.RecordBatch{Records: []*api.Record{{Value: []byte("hello world")}}},
+	})
+	if err != nil {
+		t.Fatalf("got err: %v, want nil when there are no peers to replicate to", err)
+	}
+}
+
+func TestJoinIsIdempotent(t *testing.T) {
+	r := New(ModeSyncAll, grpc.WithInsecure())
+	defer r.Close()
+
+	if err := r.Join("peer-1", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Join("peer-1", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.peers) != 1 {
+		t.Fatalf("got %d peers, want 1 after joining the same id twice", len(r.peers))
+	}
+}
+
+func TestLeaveUnknownPeerIsANoop(t *testing.T) {
+	r := New(ModeSyncAll)
+	if err := r.Leave("never-joined"); err != nil {
+		t.Fatalf("got err: %v, want nil leaving an id that never joined", err)
+	}
+}
+
+func TestLeaveTearsDownTheConnection(t *testing.T) {
+	r := New(ModeSyncAll, grpc.WithInsecure())
+
+	if err := r.Join("peer-1", "127.0.0.1:0"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Leave("peer-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.peers["peer-1"]; ok {
+		t.Fatal("peer-1 should have been removed from r.peers")
+	}
+}
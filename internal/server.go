@@ -4,74 +4,182 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
 
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpc_auth "github.com/grpc-ecosystem/go-grpc-middleware/auth"
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/hashicorp/raft"
 	"github.com/hashicorp/serf/serf"
+	"github.com/prometheus/client_golang/prometheus"
 	api "github.com/travisjeffery/proglog/api/v1"
-	"golang.org/x/sync/errgroup"
+	"github.com/travisjeffery/proglog/internal/auth"
+	"github.com/travisjeffery/proglog/internal/certs"
+	ierrors "github.com/travisjeffery/proglog/internal/interceptors/errors"
+	"github.com/travisjeffery/proglog/internal/raftlog"
+	"github.com/travisjeffery/proglog/internal/replicator"
+	"github.com/travisjeffery/proglog/internal/telemetry"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
 )
 
 var _ api.LogServer = (*grpcServer)(nil)
 
+const (
+	rpcAddrKey  = "rpc_addr"
+	raftAddrKey = "raft_addr"
+)
+
 type Config struct {
+	CommitLog  logger
 	SerfConfig *serf.Config
 	TLSConfig  *TLSConfig
 	RPCAddr    string
+	Authorizer auth.Authorizer
+
+	// Raft replication. Leave DataDir empty to run the log standalone,
+	// without a Raft cluster backing it (e.g. in tests).
+	RaftBindAddr string
+	DataDir      string
+	Bootstrap    bool
+
+	// ReplicationMode selects the gossip-driven replicator (see package
+	// replicator) as the log's replication path. It only takes effect when
+	// DataDir is empty, i.e. the node isn't running a Raft cluster; leave it
+	// unset to run standalone or let Raft handle replication.
+	ReplicationMode replicator.Mode
+
+	// Observability. Both are opt-in: a zero-value Config runs without
+	// either, matching every existing test.
+	MetricsEnabled bool
+	HTTPBindAddr   string
+	TracingEnabled bool
 }
 
 type TLSConfig struct {
 	CACert                string
 	ClientCert, ClientKey string
+
+	// AutoTLS bootstraps an internal CA plus one node cert, valid for both
+	// server and client auth, under Dir on first boot, and rotates that cert
+	// off disk every RotateInterval without a restart. When set, CACert/
+	// ClientCert/ClientKey are ignored in favor of the generated files.
+	AutoTLS        bool
+	Dir            string
+	CertHosts      []string
+	RotateInterval time.Duration
 }
 
-func NewAPI(log logger, opts ...grpc.ServerOption) (*grpc.Server, error) {
-	opts = append(opts, grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-		grpc_auth.StreamServerInterceptor(auth),
-	)), grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-		grpc_auth.UnaryServerInterceptor(auth),
-	)))
-	gsrv := grpc.NewServer(opts...)
-	srv, err := newgrpcServer(log)
+// NewAPI builds the gRPC server plus any opt-in sidecars (the /metrics HTTP
+// listener) and returns a cleanup func the caller must run alongside
+// gsrv.Stop() to tear those sidecars down; a no-op cleanup is returned when
+// there's nothing to tear down.
+func NewAPI(config *Config, opts ...grpc.ServerOption) (*grpc.Server, func(), error) {
+	srv, err := newgrpcServer(config)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+
+	streamInterceptors := []grpc.StreamServerInterceptor{
+		grpc_auth.StreamServerInterceptor(authenticate),
+		srv.authorizeStream,
+		ierrors.StreamServerInterceptor(),
+	}
+	unaryInterceptors := []grpc.UnaryServerInterceptor{
+		grpc_auth.UnaryServerInterceptor(authenticate),
+		srv.authorizeUnary,
+		ierrors.UnaryServerInterceptor(),
+	}
+	if config.TracingEnabled {
+		streamInterceptors = append([]grpc.StreamServerInterceptor{otelgrpc.StreamServerInterceptor()}, streamInterceptors...)
+		unaryInterceptors = append([]grpc.UnaryServerInterceptor{otelgrpc.UnaryServerInterceptor()}, unaryInterceptors...)
+	}
+	if config.MetricsEnabled {
+		streamInterceptors = append([]grpc.StreamServerInterceptor{grpc_prometheus.StreamServerInterceptor}, streamInterceptors...)
+		unaryInterceptors = append([]grpc.UnaryServerInterceptor{grpc_prometheus.UnaryServerInterceptor}, unaryInterceptors...)
+	}
+
+	opts = append(opts,
+		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(streamInterceptors...)),
+		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(unaryInterceptors...)),
+	)
+	gsrv := grpc.NewServer(opts...)
 	api.RegisterLogServer(gsrv, srv)
-	return gsrv, nil
+
+	cleanup := func() {}
+	if config.MetricsEnabled && config.HTTPBindAddr != "" {
+		grpc_prometheus.Register(gsrv)
+		ctx, cancel := context.WithCancel(context.Background())
+		cleanup = cancel
+		go func() {
+			if err := telemetry.ServeHTTP(ctx, config.HTTPBindAddr); err != nil {
+				log.Printf("metrics http server on %s: %s", config.HTTPBindAddr, err)
+			}
+		}()
+	}
+
+	return gsrv, cleanup, nil
 }
 
-func newgrpcServer(log logger) (srv *grpcServer, err error) {
+func newgrpcServer(config *Config) (srv *grpcServer, err error) {
 	srv = &grpcServer{
-		log: log,
+		Config: config,
+		log:    config.CommitLog,
 	}
-	err = srv.setupSerf()
-	if err != nil {
+	if err = srv.setupSerf(); err != nil {
 		return nil, err
 	}
-	err = srv.setupTLS()
-	if err != nil {
+	if err = srv.setupTLS(); err != nil {
+		return nil, err
+	}
+	if err = srv.setupRaft(); err != nil {
+		return nil, err
+	}
+	if err = srv.setupReplicator(); err != nil {
 		return nil, err
 	}
+	srv.setupMetrics()
 	return srv, nil
 }
 
 type grpcServer struct {
-	Config   *Config
-	log      logger
-	serf     *serf.Serf
-	events   chan serf.Event
-	tlsCreds credentials.TransportCredentials
+	Config      *Config
+	log         logger
+	serf        *serf.Serf
+	events      chan serf.Event
+	tlsCreds    credentials.TransportCredentials
+	tlsConfig   *tls.Config
+	certRotator *certs.Rotator
+	raftLog     *raftlog.Log
+	replicator  *replicator.Replicator
+	metrics     *telemetry.Metrics
+
+	mu    sync.Mutex
+	peers map[string]string // raft server ID -> RPC addr
 }
 
 func (s *grpcServer) setupSerf() (err error) {
+	if s.Config.SerfConfig == nil {
+		return nil
+	}
 	conf := s.Config.SerfConfig
 	conf.Init()
 	conf.Tags[rpcAddrKey] = s.Config.RPCAddr
+	if s.Config.RaftBindAddr != "" {
+		conf.Tags[raftAddrKey] = s.Config.RaftBindAddr
+	}
 	s.events = make(chan serf.Event)
 	conf.EventCh = s.events
 	s.serf, err = serf.Create(conf)
@@ -83,15 +191,21 @@ func (s *grpcServer) setupSerf() (err error) {
 }
 
 func (s *grpcServer) setupTLS() (err error) {
-	clientCrt, err := tls.LoadX509KeyPair(
-		s.Config.TLSConfig.ClientCert,
-		s.Config.TLSConfig.ClientKey,
-	)
+	cfg := s.Config.TLSConfig
+	if cfg == nil {
+		return nil
+	}
+
+	if cfg.AutoTLS {
+		return s.setupAutoTLS(cfg)
+	}
+
+	clientCrt, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
 	if err != nil {
 		return err
 	}
 
-	rawCACert, err := ioutil.ReadFile(s.Config.TLSConfig.CACert)
+	rawCACert, err := ioutil.ReadFile(cfg.CACert)
 	if err != nil {
 		return err
 	}
@@ -99,53 +213,233 @@ func (s *grpcServer) setupTLS() (err error) {
 	caCertPool := x509.NewCertPool()
 	caCertPool.AppendCertsFromPEM(rawCACert)
 
-	s.tlsCreds = credentials.NewTLS(&tls.Config{
+	s.tlsConfig = &tls.Config{
 		Certificates: []tls.Certificate{clientCrt},
 		RootCAs:      caCertPool,
-	})
+	}
+	s.tlsCreds = credentials.NewTLS(s.tlsConfig)
 
 	return nil
 }
 
-func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
-	offset, err := s.log.AppendBatch(req.RecordBatch)
+// setupAutoTLS bootstraps an internal CA and this node's certs on first
+// boot, then builds a tls.Config whose certificate and trust roots are read
+// off disk through a certs.Rotator so an operator can rotate either without
+// restarting the server.
+func (s *grpcServer) setupAutoTLS(cfg *TLSConfig) error {
+	if err := certs.Bootstrap(cfg.Dir, cfg.CertHosts); err != nil {
+		return fmt.Errorf("bootstrap certs: %w", err)
+	}
+
+	rotator, err := certs.NewRotator(
+		filepath.Join(cfg.Dir, "server.pem"),
+		filepath.Join(cfg.Dir, "server-key.pem"),
+		filepath.Join(cfg.Dir, "ca.pem"),
+	)
 	if err != nil {
-		return nil, err
+		return fmt.Errorf("new cert rotator: %w", err)
+	}
+	rotator.Start(cfg.RotateInterval)
+	s.certRotator = rotator
+
+	s.tlsConfig = &tls.Config{
+		GetCertificate:       rotator.GetCertificate,
+		GetClientCertificate: rotator.GetClientCertificate,
+		ClientAuth:           tls.RequireAndVerifyClientCert,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			pool, err := rotator.CAPool()
+			if err != nil {
+				return nil, err
+			}
+			return &tls.Config{
+				GetCertificate: rotator.GetCertificate,
+				ClientAuth:     tls.RequireAndVerifyClientCert,
+				ClientCAs:      pool,
+			}, nil
+		},
 	}
-	return &api.ProduceResponse{FirstOffset: offset}, s.replicateProduce(ctx, req)
+	s.tlsCreds = credentials.NewTLS(s.tlsConfig)
+	return nil
 }
 
-func (s *grpcServer) replicateProduce(ctx context.Context, req *api.ProduceRequest) error {
-	g, ctx := errgroup.WithContext(ctx)
-	for _, member := range s.serf.Members() {
-		server := decodeParts(member)
-		if server.rpcAddr == s.Config.RPCAddr {
-			// ignore the member of the current server
-			continue
-		}
-		g.Go(func() error {
-			// TODO(tj): optimize this
+// setupRaft stands up the Raft cluster backing the commit log. It's opt-in:
+// a Config without a DataDir runs the log standalone, which is what lets the
+// existing single-process tests keep working without a cluster.
+func (s *grpcServer) setupRaft() (err error) {
+	if s.Config.DataDir == "" {
+		return nil
+	}
+
+	ln, err := net.Listen("tcp", s.Config.RaftBindAddr)
+	if err != nil {
+		return err
+	}
 
-			cc, err := grpc.Dial(server.rpcAddr, grpc.WithTransportCredentials(s.tlsCreds))
+	var peerTLSConfig func() (*tls.Config, error)
+	if s.certRotator != nil {
+		rotator := s.certRotator
+		peerTLSConfig = func() (*tls.Config, error) {
+			pool, err := rotator.CAPool()
 			if err != nil {
-				return err
+				return nil, err
 			}
-			defer cc.Close()
+			return &tls.Config{
+				GetClientCertificate: rotator.GetClientCertificate,
+				RootCAs:              pool,
+			}, nil
+		}
+	}
 
-			client := api.NewLogClient(cc)
+	raftConfig := raftlog.Config{
+		StreamLayer: raftlog.NewStreamLayer(ln, s.tlsConfig, peerTLSConfig),
+		Bootstrap:   s.Config.Bootstrap,
+		DataDir:     s.Config.DataDir,
+	}
+	raftConfig.Config = *raft.DefaultConfig()
+	if s.Config.SerfConfig != nil {
+		// Keyed the same way eventHandler keys s.peers and AddVoter/
+		// RemoveServer, so a leader looking itself up (or a peer looking the
+		// leader up) resolves against the same namespace everywhere.
+		raftConfig.LocalID = raft.ServerID(s.Config.SerfConfig.NodeName)
+	}
 
-			_, err = client.Produce(ctx, req)
-			if err != nil {
-				return err
+	s.raftLog, err = raftlog.NewLog(s.log, raftConfig)
+	return err
+}
+
+// setupReplicator stands up the gossip-driven replicator for nodes that
+// aren't running a Raft cluster. It's opt-in and mutually exclusive with
+// Raft: a node with a DataDir replicates through raftLog instead, and a node
+// with neither runs standalone, which is what lets the existing
+// single-process tests keep working unchanged.
+func (s *grpcServer) setupReplicator() error {
+	if s.raftLog != nil || s.Config.SerfConfig == nil || s.Config.ReplicationMode == "" {
+		return nil
+	}
+
+	dialCreds, err := s.replicationDialCreds()
+	if err != nil {
+		return err
+	}
+	var dialOpts []grpc.DialOption
+	if dialCreds != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(dialCreds))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+
+	s.replicator = replicator.New(s.Config.ReplicationMode, dialOpts...)
+	return nil
+}
+
+// replicationDialCreds builds the credentials replication dials verify the
+// peer against. Under AutoTLS, s.tlsCreds is built from a server-side
+// tls.Config (GetConfigForClient, no RootCAs) that's never consulted on the
+// dial side, so it's rebuilt here as a client-side tls.Config carrying the
+// rotator's CA pool and client certificate. Unlike setupRaft's per-dial
+// peerTLSConfig, the CA pool is read once, when this is called, so a CA
+// added to ca.pem afterwards is not trusted by replication dials. Outside
+// of AutoTLS, s.tlsCreds already has a static RootCAs pool and works
+// unchanged.
+func (s *grpcServer) replicationDialCreds() (credentials.TransportCredentials, error) {
+	if s.certRotator == nil {
+		return s.tlsCreds, nil
+	}
+	pool, err := s.certRotator.CAPool()
+	if err != nil {
+		return nil, err
+	}
+	return credentials.NewTLS(&tls.Config{
+		GetClientCertificate: s.certRotator.GetClientCertificate,
+		RootCAs:              pool,
+	}), nil
+}
+
+// setupMetrics registers proglog's custom collectors and, when the log is
+// Raft-backed, starts a goroutine exporting this node's applied index so an
+// operator can graph per-follower replication lag as the gap between a
+// follower's and the leader's exported value.
+func (s *grpcServer) setupMetrics() {
+	if !s.Config.MetricsEnabled {
+		return
+	}
+	s.metrics = telemetry.NewMetrics(prometheus.DefaultRegisterer)
+
+	if s.raftLog == nil {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			s.metrics.AppliedIndex.WithLabelValues(s.Config.RPCAddr).Set(float64(s.raftLog.AppliedIndex()))
+		}
+	}()
+}
+
+func (s *grpcServer) Produce(ctx context.Context, req *api.ProduceRequest) (*api.ProduceResponse, error) {
+	start := time.Now()
+	defer func() {
+		if s.metrics != nil {
+			s.metrics.ObserveAppend(start)
+		}
+	}()
+
+	ctx, span := telemetry.Tracer().Start(ctx, "grpcServer.Produce")
+	defer span.End()
+
+	if s.raftLog == nil {
+		offset, err := s.log.AppendBatch(req.RecordBatch)
+		if err != nil {
+			return nil, err
+		}
+		if s.replicator != nil {
+			if err := s.replicator.Replicate(ctx, req); err != nil {
+				return nil, err
 			}
+		}
+		return &api.ProduceResponse{FirstOffset: offset}, nil
+	}
+
+	if !s.raftLog.IsLeader() {
+		return nil, s.notLeaderErr(ctx)
+	}
 
-			return nil
-		})
+	_, replicateSpan := telemetry.Tracer().Start(ctx, "grpcServer.Produce.replicate")
+	offset, err := s.raftLog.Append(req.RecordBatch)
+	replicateSpan.End()
+	if err != nil {
+		return nil, err
+	}
+	return &api.ProduceResponse{FirstOffset: offset}, nil
+}
+
+// notLeaderErr rejects a Produce sent to a follower, surfacing the current
+// leader's RPC addr as response metadata so the client (or a fronting proxy)
+// can retry against it instead of the Serf member list.
+func (s *grpcServer) notLeaderErr(ctx context.Context) error {
+	s.mu.Lock()
+	leaderAddr := s.peers[s.raftLog.LeaderID()]
+	s.mu.Unlock()
+	if leaderAddr != "" {
+		_ = grpc.SetHeader(ctx, metadata.Pairs(leaderRPCAddrMD, leaderAddr))
 	}
-	return g.Wait()
+	return status.Error(codes.FailedPrecondition, "server is not the raft leader")
 }
 
+const leaderRPCAddrMD = "leader-rpc-addr"
+
 func (s *grpcServer) Consume(ctx context.Context, req *api.ConsumeRequest) (*api.ConsumeResponse, error) {
+	start := time.Now()
+	defer func() {
+		if s.metrics != nil {
+			s.metrics.ObserveRead(start)
+		}
+	}()
+
+	_, span := telemetry.Tracer().Start(ctx, "grpcServer.Consume")
+	defer span.End()
+
 	batch, err := s.log.ReadBatch(req.Offset)
 	if err != nil {
 		return nil, err
@@ -187,13 +481,136 @@ type logger interface {
 	ReadBatch(uint64) (*api.RecordBatch, error)
 }
 
-func auth(ctx context.Context) (context.Context, error) {
-	peer, ok := peer.FromContext(ctx)
-	if ok {
-		tlsInfo := peer.AuthInfo.(credentials.TLSInfo)
-		addr := peer.Addr.String()
-		username := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
-		log.Printf("auth: %s: %s", addr, username)
+// eventHandler drives cluster membership off of Serf's gossip: joins add
+// raft voters (and record the member's RPC addr for NotLeader redirects),
+// leaves/failures remove them from the Raft configuration.
+func (s *grpcServer) eventHandler() {
+	for e := range s.events {
+		switch e.EventType() {
+		case serf.EventMemberJoin:
+			for _, member := range e.(serf.MemberEvent).Members {
+				parts := decodeParts(member)
+				if parts.rpcAddr == s.Config.RPCAddr {
+					// ignore the member of the current server
+					continue
+				}
+				s.mu.Lock()
+				if s.peers == nil {
+					s.peers = make(map[string]string)
+				}
+				s.peers[member.Name] = parts.rpcAddr
+				s.mu.Unlock()
+
+				if s.replicator != nil {
+					if err := s.replicator.Join(member.Name, parts.rpcAddr); err != nil {
+						log.Printf("failed to join replicator peer: %s: %s", member.Name, err)
+					}
+				}
+
+				if s.raftLog == nil {
+					continue
+				}
+				raftAddr, ok := member.Tags[raftAddrKey]
+				if !ok {
+					continue
+				}
+				if err := s.raftLog.AddVoter(member.Name, raftAddr); err != nil {
+					log.Printf("failed to add raft voter: %s: %s", member.Name, err)
+				}
+			}
+		case serf.EventMemberLeave, serf.EventMemberFailed:
+			for _, member := range e.(serf.MemberEvent).Members {
+				s.mu.Lock()
+				delete(s.peers, member.Name)
+				s.mu.Unlock()
+
+				if s.replicator != nil {
+					if err := s.replicator.Leave(member.Name); err != nil {
+						log.Printf("failed to leave replicator peer: %s: %s", member.Name, err)
+					}
+				}
+
+				if s.raftLog == nil {
+					continue
+				}
+				if err := s.raftLog.RemoveServer(member.Name); err != nil {
+					log.Printf("failed to remove raft server: %s: %s", member.Name, err)
+				}
+			}
+		}
+	}
+}
+
+type parts struct {
+	rpcAddr string
+}
+
+func decodeParts(member serf.Member) parts {
+	return parts{rpcAddr: member.Tags[rpcAddrKey]}
+}
+
+// authenticate resolves the client cert's CommonName as the request's
+// subject and threads it into the context, so authorizeUnary/authorizeStream
+// (and anything further downstream) can see who's calling without
+// re-parsing the peer cert.
+func authenticate(ctx context.Context) (context.Context, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return ctx, nil
+	}
+	if len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ctx, nil
+	}
+	subject := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+	log.Printf("auth: %s: %s", p.Addr, subject)
+	return auth.WithSubject(ctx, subject), nil
+}
+
+// authResource is the only resource proglog's ACLs guard today.
+const authResource = "log"
+
+// authorizeUnary and authorizeStream enforce s.Config.Authorizer (when one
+// is configured) ahead of every unary/streaming RPC, denying with
+// PermissionDenied rather than letting the handler run.
+func (s *grpcServer) authorizeUnary(
+	ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler,
+) (interface{}, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *grpcServer) authorizeStream(
+	srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (s *grpcServer) authorize(ctx context.Context, fullMethod string) error {
+	if s.Config.Authorizer == nil {
+		return nil
+	}
+	return s.Config.Authorizer.Authorize(auth.Subject(ctx), authResource, actionFromMethod(fullMethod))
+}
+
+// actionFromMethod maps a gRPC full method name, e.g. "/log.Log/Produce" or
+// "/log.Log/ProduceStream", onto the ACL action it's guarded by. Unary and
+// streaming variants of the same RPC share an action.
+func actionFromMethod(fullMethod string) string {
+	switch {
+	case strings.Contains(fullMethod, "Produce"):
+		return "produce"
+	case strings.Contains(fullMethod, "Consume"):
+		return "consume"
+	default:
+		return fullMethod
 	}
-	return ctx, nil
 }
@@ -4,6 +4,7 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	stderrors "errors"
 	"io/ioutil"
 	"net"
 	"os/user"
@@ -12,8 +13,12 @@ import (
 	"testing"
 
 	api "github.com/travisjeffery/proglog/api/v1"
+	"github.com/travisjeffery/proglog/internal/auth"
+	"github.com/travisjeffery/proglog/internal/client"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
 )
 
 func TestServer(t *testing.T) {
@@ -22,6 +27,8 @@ func TestServer(t *testing.T) {
 		"produce/consume a message to/from the log succeeeds": testProduceConsume,
 		"consume past log boundary fails":                     testConsumePastBoundary,
 		"produce/consume stream succeeds":                     testProduceConsumeStream,
+		"superuser can produce and consume":                   testAuthorizeSuperuser,
+		"read-only role denied produce, unary and streaming":  testAuthorizeReadOnlyDenied,
 	} {
 		t.Run(scenario, func(t *testing.T) { fn(t) })
 	}
@@ -37,9 +44,8 @@ func testConsumeEmpty(t *testing.T) {
 	if consume != nil {
 		t.Fatalf("got consume: %v, want: nil", consume)
 	}
-	got, want := grpc.Code(err), grpc.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
-	if got != want {
-		t.Fatalf("got code: %v, want: %v, err: %v", got, want, err)
+	if !stderrors.Is(err, api.ErrOffsetOutOfRange{}) {
+		t.Fatalf("got err: %v, want: %v", err, api.ErrOffsetOutOfRange{})
 	}
 }
 
@@ -86,9 +92,8 @@ func testConsumePastBoundary(t *testing.T) {
 	if consume != nil {
 		t.Fatal("consume not nil")
 	}
-	got, want := grpc.Code(err), grpc.Code(api.ErrOffsetOutOfRange{}.GRPCStatus().Err())
-	if got != want {
-		t.Fatalf("got err: %v, want: %v", got, want)
+	if !stderrors.Is(err, api.ErrOffsetOutOfRange{}) {
+		t.Fatalf("got err: %v, want: %v", err, api.ErrOffsetOutOfRange{})
 	}
 }
 
@@ -137,7 +142,87 @@ func testProduceConsumeStream(t *testing.T) {
 	}
 }
 
+func withAuthorizer(config *Config) {
+	authorizer, err := auth.New(
+		filepath.Join("auth", "testdata", "model.conf"),
+		filepath.Join("auth", "testdata", "policy.csv"),
+	)
+	if err != nil {
+		panic(err)
+	}
+	config.Authorizer = authorizer
+}
+
+func testAuthorizeSuperuser(t *testing.T) {
+	client, _, teardown := testSetupWithCert(t, rootClientCrt, rootClientKey, withAuthorizer)
+	defer teardown()
+
+	produce, err := client.Produce(context.Background(), &api.ProduceRequest{
+		RecordBatch: &api.RecordBatch{
+			Records: []*api.Record{{Value: []byte("hello world")}},
+		},
+	})
+	check(t, err)
+
+	_, err = client.Consume(context.Background(), &api.ConsumeRequest{
+		Offset: produce.FirstOffset,
+	})
+	check(t, err)
+}
+
+// testAuthorizeReadOnlyDenied drives the authorizeUnary and authorizeStream
+// interceptors over an actual gRPC connection with the "nobody" CN, which
+// internal/auth/testdata/policy.csv only grants "consume" to, so it
+// exercises PermissionDenied through the wire rather than calling
+// CasbinAuthorizer.Authorize directly.
+func testAuthorizeReadOnlyDenied(t *testing.T) {
+	client, _, teardown := testSetupWithCert(t, nobodyClientCrt, nobodyClientKey, withAuthorizer)
+	defer teardown()
+
+	produce, err := client.Produce(context.Background(), &api.ProduceRequest{
+		RecordBatch: &api.RecordBatch{
+			Records: []*api.Record{{Value: []byte("hello world")}},
+		},
+	})
+	if produce != nil {
+		t.Fatalf("got produce: %v, want: nil", produce)
+	}
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("got code: %v, want: %v", status.Code(err), codes.PermissionDenied)
+	}
+
+	stream, err := client.ProduceStream(context.Background())
+	check(t, err)
+	check(t, stream.Send(&api.ProduceRequest{
+		RecordBatch: &api.RecordBatch{
+			Records: []*api.Record{{Value: []byte("hello world")}},
+		},
+	}))
+	_, err = stream.Recv()
+	if status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("got code: %v, want: %v", status.Code(err), codes.PermissionDenied)
+	}
+
+	// nobody is allowed to consume; the only error possible here is that the
+	// log is empty (every produce above was rejected), not PermissionDenied.
+	consume, err := client.Consume(context.Background(), &api.ConsumeRequest{Offset: 0})
+	if consume != nil || err == nil {
+		t.Fatalf("got consume: %v, err: %v, want a not-found style err", consume, err)
+	}
+	if status.Code(err) == codes.PermissionDenied {
+		t.Fatalf("nobody should be allowed to consume, got PermissionDenied")
+	}
+}
+
 func testSetup(t *testing.T) (api.LogClient, *grpc.Server, func()) {
+	return testSetupWithCert(t, clientCrt, clientKey, nil)
+}
+
+// testSetupWithCert is testSetup's general form: it dials in with the given
+// client cert/key (so authorizeUnary/authorizeStream see a specific CN) and
+// lets the caller tweak Config, e.g. to wire an Authorizer, before the
+// server starts.
+func testSetupWithCert(t *testing.T, clientCertFile, clientKeyFile string, configFn func(*Config)) (api.LogClient, *grpc.Server, func()) {
 	l, err := net.Listen("tcp", "127.0.0.1:0")
 	check(t, err)
 
@@ -146,21 +231,18 @@ func testSetup(t *testing.T) (api.LogClient, *grpc.Server, func()) {
 	caCertPool := x509.NewCertPool()
 	caCertPool.AppendCertsFromPEM(rawCACert)
 
-	clientCrt, err := tls.LoadX509KeyPair(clientCrt, clientKey)
+	clientCrt, err := tls.LoadX509KeyPair(clientCertFile, clientKeyFile)
 	check(t, err)
 
-	tlsCreds := credentials.NewTLS(&tls.Config{
+	clientTLSConfig := &tls.Config{
 		Certificates: []tls.Certificate{clientCrt},
 		RootCAs:      caCertPool,
-	})
-
-	cc, err := grpc.Dial(l.Addr().String(), grpc.WithTransportCredentials(tlsCreds))
-	check(t, err)
+	}
 
 	serverCrt, err := tls.LoadX509KeyPair(serverCrt, serverKey)
 	check(t, err)
 
-	tlsCreds = credentials.NewTLS(&tls.Config{
+	tlsCreds := credentials.NewTLS(&tls.Config{
 		Certificates: []tls.Certificate{serverCrt},
 		ClientAuth:   tls.RequireAndVerifyClientCert,
 		ClientCAs:    caCertPool,
@@ -172,17 +254,22 @@ func testSetup(t *testing.T) (api.LogClient, *grpc.Server, func()) {
 	config := &Config{
 		CommitLog: &Log{Dir: dir},
 	}
-	server, err := NewAPI(config, grpc.Creds(tlsCreds))
+	if configFn != nil {
+		configFn(config)
+	}
+	server, cleanup, err := NewAPI(config, grpc.Creds(tlsCreds))
 	check(t, err)
 
 	go func() {
 		server.Serve(l)
 	}()
 
-	client := api.NewLogClient(cc)
+	logClient, cc, err := client.New(l.Addr().String(), clientTLSConfig)
+	check(t, err)
 
-	return client, server, func() {
+	return logClient, server, func() {
 		server.Stop()
+		cleanup()
 		cc.Close()
 		l.Close()
 	}
@@ -208,6 +295,17 @@ var (
 	serverKey = configFile("server-key.pem")
 	clientCrt = configFile("client.pem")
 	clientKey = configFile("client-key.pem")
+
+	// rootClientCrt/nobodyClientCrt carry CommonName "root"/"nobody", the
+	// same subjects internal/auth/testdata/policy.csv grants superuser and
+	// read-only roles to, so testAuthorizeSuperuser and
+	// testAuthorizeReadOnlyDenied can drive the real authorizeUnary/
+	// authorizeStream interceptors end to end instead of calling
+	// CasbinAuthorizer.Authorize directly.
+	rootClientCrt   = configFile("root-client.pem")
+	rootClientKey   = configFile("root-client-key.pem")
+	nobodyClientCrt = configFile("nobody-client.pem")
+	nobodyClientKey = configFile("nobody-client-key.pem")
 )
 
 func configFile(filename string) string {
@@ -0,0 +1,59 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestNewMetrics(t *testing.T) {
+	m := NewMetrics(prometheus.NewRegistry())
+
+	m.ObserveAppend(time.Now())
+	m.ObserveRead(time.Now())
+	m.AppliedIndex.WithLabelValues("node-1").Set(42)
+}
+
+func TestServeHTTPShutsDownOnContextCancel(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- ServeHTTP(ctx, addr) }()
+
+	var resp *http.Response
+	for i := 0; i < 50; i++ {
+		resp, err = http.Get(fmt.Sprintf("http://%s/metrics", addr))
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("GET /metrics: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("got status: %d, want: %d", resp.StatusCode, http.StatusOK)
+	}
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("ServeHTTP returned: %s", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ServeHTTP did not return after ctx was canceled")
+	}
+}
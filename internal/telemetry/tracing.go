@@ -0,0 +1,40 @@
+package telemetry
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// SetupTracing installs a global TracerProvider labeled with serviceName
+// and returns a shutdown func the caller should defer. Incoming trace
+// context is read from gRPC metadata by the otelgrpc server interceptors
+// registered in NewAPI. Raft replication runs over raftlog's own stream
+// layer, not gRPC, and replicator dials carry no otelgrpc client
+// interceptor, so the work a Produce causes on other nodes does not join
+// its trace.
+func SetupTracing(ctx context.Context, serviceName string) (func(context.Context) error, error) {
+	res, err := resource.New(ctx, resource.WithAttributes(
+		semconv.ServiceNameKey.String(serviceName),
+	))
+	if err != nil {
+		return nil, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// Tracer returns the tracer proglog's own spans (as opposed to the ones
+// otelgrpc creates automatically around each RPC) should use.
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/travisjeffery/proglog")
+}